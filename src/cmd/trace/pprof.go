@@ -7,15 +7,14 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"cmd/internal/pprof/profile"
+	"cmd/internal/pprof/report"
 	"fmt"
 	"internal/trace"
 	"io"
-	"io/ioutil"
 	"net/http"
-	"os"
-	"os/exec"
+	"strconv"
 )
 
 func init() {
@@ -23,6 +22,17 @@ func init() {
 	http.HandleFunc("/block", serveSVGProfile(pprofBlock))
 	http.HandleFunc("/syscall", serveSVGProfile(pprofSyscall))
 	http.HandleFunc("/sched", serveSVGProfile(pprofSched))
+	http.HandleFunc("/gc", serveSVGProfile(pprofGC))
+	http.HandleFunc("/assist", serveSVGProfile(pprofAssist))
+	http.HandleFunc("/wall", serveSVGProfile(pprofWall))
+
+	http.HandleFunc("/io/pprof", serveProfile(pprofIO))
+	http.HandleFunc("/block/pprof", serveProfile(pprofBlock))
+	http.HandleFunc("/syscall/pprof", serveProfile(pprofSyscall))
+	http.HandleFunc("/sched/pprof", serveProfile(pprofSched))
+	http.HandleFunc("/gc/pprof", serveProfile(pprofGC))
+	http.HandleFunc("/assist/pprof", serveProfile(pprofAssist))
+	http.HandleFunc("/wall/pprof", serveProfile(pprofWall))
 }
 
 // Record represents one entry in pprof-like profiles.
@@ -32,142 +42,514 @@ type Record struct {
 	time int64
 }
 
-// pprofIO generates IO pprof-like profile (time spent in IO wait).
-func pprofIO(w io.Writer) error {
-	events, err := parseEvents()
-	if err != nil {
-		return err
+// profFilter narrows a profile down to events on a single goroutine, within
+// a time window, and/or under a single user task. The zero value matches
+// every event.
+type profFilter struct {
+	hasG     bool
+	g        uint64
+	hasStart bool
+	start    int64
+	hasEnd   bool
+	end      int64
+	hasTask  bool
+	task     uint64
+}
+
+// parseProfFilter builds a profFilter out of the goid, start, end, and
+// taskid query parameters of r.
+func parseProfFilter(r *http.Request) (*profFilter, error) {
+	f := new(profFilter)
+	if s := r.FormValue("goid"); s != "" {
+		g, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid goid %q: %v", s, err)
+		}
+		f.hasG, f.g = true, g
+	}
+	if s := r.FormValue("start"); s != "" {
+		start, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start %q: %v", s, err)
+		}
+		f.hasStart, f.start = true, start
+	}
+	if s := r.FormValue("end"); s != "" {
+		end, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end %q: %v", s, err)
+		}
+		f.hasEnd, f.end = true, end
+	}
+	if s := r.FormValue("taskid"); s != "" {
+		task, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid taskid %q: %v", s, err)
+		}
+		f.hasTask, f.task = true, task
+	}
+	return f, nil
+}
+
+// match reports whether ev, attributed to goroutine gid, passes f. gid is
+// taken as a separate parameter rather than read off ev.G because some
+// events (EvGoUnblock, most notably) are attributed to a goroutine other
+// than the one that generated them. taskOf reports the innermost user task
+// active at the time ev happened, if any; it is only consulted when f
+// filters on taskid.
+func (f *profFilter) match(gid uint64, ev *trace.Event, taskOf func(ev *trace.Event) (id uint64, ok bool)) bool {
+	if f.hasG && gid != f.g {
+		return false
+	}
+	if f.hasStart && ev.Ts < f.start {
+		return false
+	}
+	if f.hasEnd && ev.Ts > f.end {
+		return false
+	}
+	if f.hasTask {
+		id, ok := taskOf(ev)
+		if !ok || id != f.task {
+			return false
+		}
+	}
+	return true
+}
+
+// taskIndex maps each event to the id of the innermost user task active on
+// that event's goroutine at the time it happened, so that filtering by
+// taskid doesn't require re-walking the event stream from scratch for every
+// profile. Tasks are tracked per goroutine, not globally: a single shared
+// stack of open tasks would attribute every event on every goroutine to
+// whichever task happened to be innermost at that instant, even goroutines
+// that have nothing to do with it, whenever two tasks' lifetimes overlap.
+//
+// A task created with trace.NewTask on one goroutine is commonly ended by
+// task.End on another (e.g. handed off to a worker), so closing a task
+// searches every goroutine's stack for it rather than assuming it's on the
+// ending event's own goroutine.
+func taskIndex(events []*trace.Event) map[*trace.Event]uint64 {
+	active := make(map[uint64][]uint64) // goroutine id -> open task ids, outermost first
+	index := make(map[*trace.Event]uint64)
+	for _, ev := range events {
+		switch ev.Type {
+		case trace.EvUserTaskCreate:
+			active[ev.G] = append(active[ev.G], ev.Args[0])
+		case trace.EvUserTaskEnd:
+			taskid := ev.Args[0]
+			for g, stack := range active {
+				for i, id := range stack {
+					if id == taskid {
+						active[g] = append(stack[:i], stack[i+1:]...)
+						break
+					}
+				}
+			}
+		}
+		if stack := active[ev.G]; len(stack) > 0 {
+			index[ev] = stack[len(stack)-1]
+		}
+	}
+	return index
+}
+
+// buildEventProfile walks events, selecting the ones for which match returns
+// true and which pass filter, and accumulates for each selected event's
+// stack the duration reported by dur. It factors out the walk shared by the
+// simple pprof* profiles below, which differ only in which events they care
+// about and how long each one "cost".
+//
+// gidOf reports which goroutine an event's cost should be attributed to for
+// the purposes of a ?goid= filter; it defaults to ev.G when nil. That
+// default is wrong for events like EvGoUnblock and EvGoCreate, whose ev.G is
+// the goroutine that caused the event rather than the one experiencing the
+// delay being profiled, so callers built on those event types must supply
+// their own.
+func buildEventProfile(events []*trace.Event, filter *profFilter, match func(ev *trace.Event) bool, dur func(ev *trace.Event) int64, gidOf func(ev *trace.Event) uint64) *profile.Profile {
+	if gidOf == nil {
+		gidOf = func(ev *trace.Event) uint64 { return ev.G }
+	}
+	var tasks map[*trace.Event]uint64
+	if filter.hasTask {
+		tasks = taskIndex(events)
+	}
+	taskOf := func(ev *trace.Event) (uint64, bool) {
+		id, ok := tasks[ev]
+		return id, ok
 	}
 	prof := make(map[uint64]Record)
 	for _, ev := range events {
-		if ev.Type != trace.EvGoBlockNet || ev.Link == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
+		if ev.StkID == 0 || len(ev.Stk) == 0 || !match(ev) || !filter.match(gidOf(ev), ev, taskOf) {
 			continue
 		}
 		rec := prof[ev.StkID]
 		rec.stk = ev.Stk
 		rec.n++
-		rec.time += ev.Link.Ts - ev.Ts
+		rec.time += dur(ev)
 		prof[ev.StkID] = rec
 	}
-	return buildProfile(prof).Write(w)
+	return buildProfile(countDelayTypes, recordsFromCounts(prof))
 }
 
-// pprofBlock generates blocking pprof-like profile (time spent blocked on synchronization primitives).
-func pprofBlock(w io.Writer) error {
+// linkedDuration returns the time between ev and the event it is linked to.
+func linkedDuration(ev *trace.Event) int64 {
+	return ev.Link.Ts - ev.Ts
+}
+
+// pprofIO generates IO pprof-like profile (time spent in IO wait).
+func pprofIO(w io.Writer, filter *profFilter) error {
 	events, err := parseEvents()
 	if err != nil {
 		return err
 	}
-	prof := make(map[uint64]Record)
-	for _, ev := range events {
-		switch ev.Type {
-		case trace.EvGoBlockSend, trace.EvGoBlockRecv, trace.EvGoBlockSelect,
-			trace.EvGoBlockSync, trace.EvGoBlockCond:
-		default:
-			continue
-		}
-		if ev.Link == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
-			continue
-		}
-		rec := prof[ev.StkID]
-		rec.stk = ev.Stk
-		rec.n++
-		rec.time += ev.Link.Ts - ev.Ts
-		prof[ev.StkID] = rec
+	return buildEventProfile(events, filter,
+		func(ev *trace.Event) bool { return ev.Type == trace.EvGoBlockNet && ev.Link != nil },
+		linkedDuration, nil,
+	).Write(w)
+}
+
+// pprofBlock generates blocking pprof-like profile (time spent blocked on synchronization primitives).
+func pprofBlock(w io.Writer, filter *profFilter) error {
+	events, err := parseEvents()
+	if err != nil {
+		return err
 	}
-	return buildProfile(prof).Write(w)
+	return buildEventProfile(events, filter,
+		func(ev *trace.Event) bool {
+			switch ev.Type {
+			case trace.EvGoBlockSend, trace.EvGoBlockRecv, trace.EvGoBlockSelect,
+				trace.EvGoBlockSync, trace.EvGoBlockCond:
+				return ev.Link != nil
+			}
+			return false
+		},
+		linkedDuration, nil,
+	).Write(w)
 }
 
 // pprofSyscall generates syscall pprof-like profile (time spent blocked in syscalls).
-func pprofSyscall(w io.Writer) error {
+func pprofSyscall(w io.Writer, filter *profFilter) error {
 	events, err := parseEvents()
 	if err != nil {
 		return err
 	}
-	prof := make(map[uint64]Record)
-	for _, ev := range events {
-		if ev.Type != trace.EvGoSysCall || ev.Link == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
-			continue
-		}
-		rec := prof[ev.StkID]
-		rec.stk = ev.Stk
-		rec.n++
-		rec.time += ev.Link.Ts - ev.Ts
-		prof[ev.StkID] = rec
-	}
-	return buildProfile(prof).Write(w)
+	return buildEventProfile(events, filter,
+		func(ev *trace.Event) bool { return ev.Type == trace.EvGoSysCall && ev.Link != nil },
+		linkedDuration, nil,
+	).Write(w)
 }
 
 // pprofSched generates scheduler latency pprof-like profile
 // (time between a goroutine become runnable and actually scheduled for execution).
-func pprofSched(w io.Writer) error {
+func pprofSched(w io.Writer, filter *profFilter) error {
 	events, err := parseEvents()
 	if err != nil {
 		return err
 	}
-	prof := make(map[uint64]Record)
-	for _, ev := range events {
-		if (ev.Type != trace.EvGoUnblock && ev.Type != trace.EvGoCreate) ||
-			ev.Link == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
-			continue
+	return buildEventProfile(events, filter,
+		func(ev *trace.Event) bool {
+			return (ev.Type == trace.EvGoUnblock || ev.Type == trace.EvGoCreate) && ev.Link != nil
+		},
+		linkedDuration,
+		// ev.G is whoever unblocked/created the goroutine; ev.Args[0] is the
+		// goroutine whose scheduling delay is actually being measured.
+		func(ev *trace.Event) uint64 { return ev.Args[0] },
+	).Write(w)
+}
+
+// pprofGC generates a pprof-like profile of time spent in garbage collection
+// STW and concurrent mark/sweep, grouped by the stack that triggered each GC
+// cycle. Like every other paired event this file relies on, EvGCStart comes
+// back from the parser with Link already pointing at the matching EvGCDone
+// (the tracer's "previous GC is not ended before a new one" invariant
+// guarantees exactly one GC is ever open at a time).
+func pprofGC(w io.Writer, filter *profFilter) error {
+	events, err := parseEvents()
+	if err != nil {
+		return err
+	}
+	return buildEventProfile(events, filter,
+		func(ev *trace.Event) bool { return ev.Type == trace.EvGCStart && ev.Link != nil },
+		linkedDuration, nil,
+	).Write(w)
+}
+
+// pprofAssist generates a pprof-like profile of time goroutines spent
+// helping the garbage collector, either blocked waiting for GC assist credit
+// or actively mark-assisting, grouped by stack.
+func pprofAssist(w io.Writer, filter *profFilter) error {
+	events, err := parseEvents()
+	if err != nil {
+		return err
+	}
+	return buildEventProfile(events, filter,
+		func(ev *trace.Event) bool {
+			switch ev.Type {
+			case trace.EvGoBlockGC, trace.EvGCMarkAssistStart:
+				return ev.Link != nil
+			}
+			return false
+		},
+		linkedDuration, nil,
+	).Write(w)
+}
+
+// wallState is one bucket of the per-goroutine wall-clock breakdown reported
+// by pprofWall.
+type wallState int
+
+const (
+	wallRunning wallState = iota
+	wallRunnable
+	wallBlockedSync
+	wallBlockedIO
+	wallSyscall
+	wallGCAssist
+	numWallStates
+)
+
+// wallSampleTypes labels the numWallStates dimensions of a pprofWall sample.
+var wallSampleTypes = []*profile.ValueType{
+	wallRunning:     {Type: "running", Unit: "nanoseconds"},
+	wallRunnable:    {Type: "runnable", Unit: "nanoseconds"},
+	wallBlockedSync: {Type: "block-sync", Unit: "nanoseconds"},
+	wallBlockedIO:   {Type: "block-io", Unit: "nanoseconds"},
+	wallSyscall:     {Type: "syscall", Unit: "nanoseconds"},
+	wallGCAssist:    {Type: "gc-assist", Unit: "nanoseconds"},
+}
+
+// wallRecord is one stack's share of wall-clock time, broken down by the
+// state the owning goroutine was in.
+type wallRecord struct {
+	stk  []*trace.Frame
+	time [numWallStates]int64
+}
+
+// goWall is the wall-clock state machine pprofWall keeps per goroutine while
+// it walks the event stream.
+type goWall struct {
+	runStart int64 // Ts when the goroutine most recently started running
+
+	waitEv    *trace.Event // event that put the goroutine into waitState; its stack is the attribution point
+	waitState wallState
+	waitStart int64
+
+	assistEv    *trace.Event // the GCMarkAssistStart event of an assist in progress, if any
+	assistStart int64
+}
+
+// pprofWall generates a single profile.Profile with one sample-value
+// dimension per wallState, so pprof can show, for each call site, how the
+// owning goroutine's wall-clock time split across running, waiting to run,
+// blocking on synchronization, blocking on IO, blocking in syscalls, and GC
+// mark assist. Time is attributed to the stack of whichever event opened or
+// closed the span (the "blocking" event in the pair), matching how pprofIO
+// and its siblings attribute blocking time.
+//
+// EvGoWaiting and EvGoInSyscall, which mark a goroutine as already blocked
+// or already in a syscall when tracing started, carry no stack of their own
+// (EventDescriptions reports Stack=false for both, same as EvGoSysExit) and
+// have no earlier event for that goroutine to borrow one from. That initial
+// span is therefore left out of the profile entirely rather than reported
+// under a fabricated stack, the same way every other profile in this file
+// silently skips events with no stack.
+func pprofWall(w io.Writer, filter *profFilter) error {
+	events, err := parseEvents()
+	if err != nil {
+		return err
+	}
+	return buildWallProfile(events, filter).Write(w)
+}
+
+// buildWallProfile does the event walk described by pprofWall's doc comment;
+// it is split out from pprofWall so tests can drive it with synthetic events
+// instead of a parsed trace.
+func buildWallProfile(events []*trace.Event, filter *profFilter) *profile.Profile {
+	var tasks map[*trace.Event]uint64
+	if filter.hasTask {
+		tasks = taskIndex(events)
+	}
+	taskOf := func(ev *trace.Event) (uint64, bool) {
+		id, ok := tasks[ev]
+		return id, ok
+	}
+
+	prof := make(map[uint64]*wallRecord)
+	add := func(ev *trace.Event, gid uint64, state wallState, d int64) {
+		if d <= 0 || ev == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
+			return
+		}
+		if !filter.match(gid, ev, taskOf) {
+			return
 		}
 		rec := prof[ev.StkID]
-		rec.stk = ev.Stk
-		rec.n++
-		rec.time += ev.Link.Ts - ev.Ts
-		prof[ev.StkID] = rec
+		if rec == nil {
+			rec = &wallRecord{stk: ev.Stk}
+			prof[ev.StkID] = rec
+		}
+		rec.time[state] += d
 	}
-	return buildProfile(prof).Write(w)
+
+	gs := make(map[uint64]*goWall)
+	goroutine := func(g uint64) *goWall {
+		gw := gs[g]
+		if gw == nil {
+			gw = new(goWall)
+			gs[g] = gw
+		}
+		return gw
+	}
+
+	for _, ev := range events {
+		switch ev.Type {
+		case trace.EvGoCreate:
+			target := goroutine(ev.Args[0])
+			target.waitEv, target.waitState, target.waitStart = ev, wallRunnable, ev.Ts
+		case trace.EvGoStart, trace.EvGoStartLabel:
+			g := goroutine(ev.G)
+			add(g.waitEv, ev.G, g.waitState, ev.Ts-g.waitStart)
+			g.waitEv = nil
+			g.runStart = ev.Ts
+		case trace.EvGoBlockSend, trace.EvGoBlockRecv, trace.EvGoBlockSelect,
+			trace.EvGoBlockSync, trace.EvGoBlockCond, trace.EvGoBlockGC:
+			g := goroutine(ev.G)
+			add(ev, ev.G, wallRunning, ev.Ts-g.runStart)
+			g.waitEv, g.waitState, g.waitStart = ev, wallBlockedSync, ev.Ts
+		case trace.EvGoBlockNet:
+			g := goroutine(ev.G)
+			add(ev, ev.G, wallRunning, ev.Ts-g.runStart)
+			g.waitEv, g.waitState, g.waitStart = ev, wallBlockedIO, ev.Ts
+		case trace.EvGoSched, trace.EvGoPreempt:
+			g := goroutine(ev.G)
+			add(ev, ev.G, wallRunning, ev.Ts-g.runStart)
+			g.waitEv, g.waitState, g.waitStart = ev, wallRunnable, ev.Ts
+		case trace.EvGoSysCall:
+			g := goroutine(ev.G)
+			add(ev, ev.G, wallRunning, ev.Ts-g.runStart)
+			g.waitEv, g.waitState, g.waitStart = ev, wallSyscall, ev.Ts
+		case trace.EvGoSysExit:
+			g := goroutine(ev.G)
+			add(g.waitEv, ev.G, wallSyscall, ev.Ts-g.waitStart)
+			// EvGoSysExit itself carries no stack (Stack=false), so keep
+			// attributing the runnable wait that follows it to the call site
+			// of the syscall that's finishing (g.waitEv, unchanged) rather
+			// than to the stackless exit event itself.
+			g.waitState, g.waitStart = wallRunnable, ev.Ts
+		case trace.EvGoUnblock:
+			g := goroutine(ev.Args[0])
+			add(g.waitEv, ev.Args[0], g.waitState, ev.Ts-g.waitStart)
+			g.waitState, g.waitStart = wallRunnable, ev.Ts
+		case trace.EvGCMarkAssistStart:
+			g := goroutine(ev.G)
+			add(ev, ev.G, wallRunning, ev.Ts-g.runStart)
+			g.assistEv, g.assistStart = ev, ev.Ts
+		case trace.EvGCMarkAssistDone:
+			g := goroutine(ev.G)
+			add(g.assistEv, ev.G, wallGCAssist, ev.Ts-g.assistStart)
+			g.assistEv = nil
+			g.runStart = ev.Ts
+		}
+	}
+
+	recs := make(map[uint64]sampleRecord, len(prof))
+	for id, rec := range prof {
+		values := make([]int64, numWallStates)
+		copy(values, rec.time[:])
+		recs[id] = sampleRecord{stk: rec.stk, values: values}
+	}
+	return buildProfile(wallSampleTypes, recs)
 }
 
-// serveSVGProfile serves pprof-like profile generated by prof as svg.
-func serveSVGProfile(prof func(w io.Writer) error) http.HandlerFunc {
+// serveProfile serves the pprof-like profile generated by prof directly as a
+// gzip-compressed protobuf, so it can be fetched by "go tool pprof" itself
+// (e.g. "go tool pprof http://host/debug/trace/io/pprof") for interactive
+// exploration, flamegraphs, or diffing against another profile.
+func serveProfile(prof func(w io.Writer, filter *profFilter) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		blockf, err := ioutil.TempFile("", "block")
+		filter, err := parseProfFilter(r)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("failed to create temp file: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		defer func() {
-			blockf.Close()
-			os.Remove(blockf.Name())
-		}()
-		blockb := bufio.NewWriter(blockf)
-		if err := prof(blockb); err != nil {
+		var buf bytes.Buffer
+		if err := prof(&buf, filter); err != nil {
 			http.Error(w, fmt.Sprintf("failed to generate profile: %v", err), http.StatusInternalServerError)
 			return
 		}
-		if err := blockb.Flush(); err != nil {
-			http.Error(w, fmt.Sprintf("failed to flush temp file: %v", err), http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(buf.Bytes())
+	}
+}
+
+// serveSVGProfile serves the pprof-like profile generated by prof as an svg,
+// rendered in-process by the pprof report driver rather than by shelling out
+// to "go tool pprof".
+func serveSVGProfile(prof func(w io.Writer, filter *profFilter) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseProfFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var buf bytes.Buffer
+		if err := prof(&buf, filter); err != nil {
+			http.Error(w, fmt.Sprintf("failed to generate profile: %v", err), http.StatusInternalServerError)
 			return
 		}
-		if err := blockf.Close(); err != nil {
-			http.Error(w, fmt.Sprintf("failed to close temp file: %v", err), http.StatusInternalServerError)
+		p, err := profile.Parse(&buf)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse profile: %v", err), http.StatusInternalServerError)
 			return
 		}
-		svgFilename := blockf.Name() + ".svg"
-		if output, err := exec.Command("go", "tool", "pprof", "-svg", "-output", svgFilename, blockf.Name()).CombinedOutput(); err != nil {
-			http.Error(w, fmt.Sprintf("failed to execute go tool pprof: %v\n%s", err, output), http.StatusInternalServerError)
+		var svg bytes.Buffer
+		if err := report.Generate(&svg, report.New(p, &report.Options{OutputFormat: report.SVG})); err != nil {
+			http.Error(w, fmt.Sprintf("failed to render profile: %v", err), http.StatusInternalServerError)
 			return
 		}
-		defer os.Remove(svgFilename)
 		w.Header().Set("Content-Type", "image/svg+xml")
-		http.ServeFile(w, r, svgFilename)
+		w.Write(svg.Bytes())
 	}
 }
 
-func buildProfile(prof map[uint64]Record) *profile.Profile {
+// countDelayTypes is the sample shape used by every profile that reports a
+// count of events plus the total delay they caused, which is all of them
+// except pprofWall.
+var countDelayTypes = []*profile.ValueType{
+	{Type: "contentions", Unit: "count"},
+	{Type: "delay", Unit: "nanoseconds"},
+}
+
+// sampleRecord is one stack's contribution to a profile: the stack itself,
+// plus one accumulated value per dimension in the profile's SampleType.
+type sampleRecord struct {
+	stk    []*trace.Frame
+	values []int64
+}
+
+// recordsFromCounts adapts the n/time accumulator shared by the simple
+// pprof* profiles to the len(values)-per-stack shape buildProfile expects.
+func recordsFromCounts(prof map[uint64]Record) map[uint64]sampleRecord {
+	recs := make(map[uint64]sampleRecord, len(prof))
+	for id, rec := range prof {
+		recs[id] = sampleRecord{stk: rec.stk, values: []int64{int64(rec.n), rec.time}}
+	}
+	return recs
+}
+
+// buildProfile builds a *profile.Profile whose samples carry len(types)
+// values each, as given by recs. It's generalized over the number of sample
+// dimensions so that it can serve both the two-dimensional
+// contentions/delay profiles (pprofIO and its siblings) and the
+// multi-dimensional breakdown produced by pprofWall.
+func buildProfile(types []*profile.ValueType, recs map[uint64]sampleRecord) *profile.Profile {
 	p := &profile.Profile{
 		PeriodType: &profile.ValueType{Type: "trace", Unit: "count"},
 		Period:     1,
-		SampleType: []*profile.ValueType{
-			{Type: "contentions", Unit: "count"},
-			{Type: "delay", Unit: "nanoseconds"},
-		},
+		SampleType: types,
 	}
 	locs := make(map[uint64]*profile.Location)
 	funcs := make(map[string]*profile.Function)
-	for _, rec := range prof {
+	for _, rec := range recs {
 		var sloc []*profile.Location
 		for _, frame := range rec.stk {
 			loc := locs[frame.PC]
@@ -199,7 +581,7 @@ func buildProfile(prof map[uint64]Record) *profile.Profile {
 			sloc = append(sloc, loc)
 		}
 		p.Sample = append(p.Sample, &profile.Sample{
-			Value:    []int64{int64(rec.n), rec.time},
+			Value:    rec.values,
 			Location: sloc,
 		})
 	}
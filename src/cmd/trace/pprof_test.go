@@ -0,0 +1,184 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"internal/trace"
+	"testing"
+)
+
+// TestPprofSchedGoidFiltersTargetGoroutine checks that filtering the
+// scheduler-latency profile by ?goid= matches the goroutine that actually
+// experienced the delay, not the goroutine that generated the EvGoUnblock or
+// EvGoCreate event (the unblocker/creator, recorded as ev.G).
+func TestPprofSchedGoidFiltersTargetGoroutine(t *testing.T) {
+	stk := []*trace.Frame{{PC: 1, Fn: "main.worker"}}
+	unblocked := &trace.Event{Type: trace.EvGoUnblock, StkID: 1, Stk: stk, G: 2, Ts: 100, Args: [3]uint64{42}}
+	unblocked.Link = &trace.Event{Ts: 150}
+
+	match := func(ev *trace.Event) bool {
+		return (ev.Type == trace.EvGoUnblock || ev.Type == trace.EvGoCreate) && ev.Link != nil
+	}
+	gidOf := func(ev *trace.Event) uint64 { return ev.Args[0] }
+
+	events := []*trace.Event{unblocked}
+
+	for _, tt := range []struct {
+		name    string
+		filter  *profFilter
+		samples int
+	}{
+		{"unfiltered", &profFilter{}, 1},
+		{"matches target goroutine", &profFilter{hasG: true, g: 42}, 1},
+		{"matches unblocker, not target", &profFilter{hasG: true, g: 2}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := buildEventProfile(events, tt.filter, match, linkedDuration, gidOf)
+			if got := len(p.Sample); got != tt.samples {
+				t.Errorf("got %d samples, want %d", got, tt.samples)
+			}
+		})
+	}
+}
+
+// TestTaskIndexConcurrentTasksOnDifferentGoroutines checks that two
+// concurrently open tasks on different goroutines don't bleed into each
+// other or into an unrelated third goroutine that has no task open at all.
+func TestTaskIndexConcurrentTasksOnDifferentGoroutines(t *testing.T) {
+	const g1, g2, g3 = 1, 2, 3
+	createTask1 := &trace.Event{Type: trace.EvUserTaskCreate, G: g1, Args: [3]uint64{1}}
+	createTask2 := &trace.Event{Type: trace.EvUserTaskCreate, G: g2, Args: [3]uint64{2}}
+	onG3 := &trace.Event{Type: trace.EvGoSysCall, G: g3}
+	onG1 := &trace.Event{Type: trace.EvGoSysCall, G: g1}
+	onG2 := &trace.Event{Type: trace.EvGoSysCall, G: g2}
+	endTask2 := &trace.Event{Type: trace.EvUserTaskEnd, G: g2, Args: [3]uint64{2}}
+	endTask1 := &trace.Event{Type: trace.EvUserTaskEnd, G: g1, Args: [3]uint64{1}}
+
+	index := taskIndex([]*trace.Event{createTask1, createTask2, onG3, onG1, onG2, endTask2, endTask1})
+
+	if id, ok := index[onG3]; ok {
+		t.Errorf("event on unrelated goroutine g3 got task %d, want no task", id)
+	}
+	if id, ok := index[onG1]; !ok || id != 1 {
+		t.Errorf("event on g1 got task (%d, %v), want (1, true)", id, ok)
+	}
+	if id, ok := index[onG2]; !ok || id != 2 {
+		t.Errorf("event on g2 got task (%d, %v), want (2, true)", id, ok)
+	}
+}
+
+// TestPprofWallSyscallRunnableAfterExit checks that the wall-clock profile
+// attributes the runnable gap between a syscall returning and the goroutine
+// actually being scheduled again, even though the EvGoSysExit event that
+// closes the syscall carries no stack of its own to attribute it to.
+func TestPprofWallSyscallRunnableAfterExit(t *testing.T) {
+	stk := []*trace.Frame{{PC: 1, Fn: "main.doSyscall"}}
+	const g = 1
+	enter := &trace.Event{Type: trace.EvGoSysCall, G: g, StkID: 1, Stk: stk, Ts: 100}
+	exit := &trace.Event{Type: trace.EvGoSysExit, G: g, Ts: 150}
+	start := &trace.Event{Type: trace.EvGoStart, G: g, Ts: 170}
+
+	events := []*trace.Event{enter, exit, start}
+
+	p := buildWallProfile(events, new(profFilter))
+	if len(p.Sample) != 1 {
+		t.Fatalf("got %d samples, want 1", len(p.Sample))
+	}
+	values := p.Sample[0].Value
+	if values[wallSyscall] != 50 {
+		t.Errorf("syscall time = %d, want 50", values[wallSyscall])
+	}
+	if values[wallRunnable] != 20 {
+		t.Errorf("runnable time = %d, want 20 (the gap between GoSysExit and GoStart)", values[wallRunnable])
+	}
+}
+
+// TestPprofGCLinksStartToDone checks that the GC profile pairs each
+// EvGCStart with its linked EvGCDone and reports the stack-to-stop wall
+// time between them, the same way pprofIO et al. pair their blocking events.
+func TestPprofGCLinksStartToDone(t *testing.T) {
+	stk := []*trace.Frame{{PC: 1, Fn: "runtime.gcStart"}}
+	start := &trace.Event{Type: trace.EvGCStart, StkID: 1, Stk: stk, Ts: 100}
+	start.Link = &trace.Event{Ts: 140}
+
+	match := func(ev *trace.Event) bool { return ev.Type == trace.EvGCStart && ev.Link != nil }
+
+	p := buildEventProfile([]*trace.Event{start}, new(profFilter), match, linkedDuration, nil)
+	if len(p.Sample) != 1 {
+		t.Fatalf("got %d samples, want 1", len(p.Sample))
+	}
+	if got := p.Sample[0].Value[1]; got != 40 {
+		t.Errorf("GC duration = %d, want 40", got)
+	}
+}
+
+// TestBuildEventProfileFilterParams checks that start/end/taskid filtering
+// in buildEventProfile actually narrows the result, not just ?goid=.
+func TestBuildEventProfileFilterParams(t *testing.T) {
+	stk := []*trace.Frame{{PC: 1, Fn: "main.worker"}}
+	const g = 1
+	create := &trace.Event{Type: trace.EvUserTaskCreate, G: g, Ts: 0, Args: [3]uint64{9}}
+	ev := &trace.Event{Type: trace.EvGoSysCall, G: g, StkID: 1, Stk: stk, Ts: 100}
+	ev.Link = &trace.Event{Ts: 120}
+	end := &trace.Event{Type: trace.EvUserTaskEnd, G: g, Ts: 200, Args: [3]uint64{9}}
+
+	match := func(ev *trace.Event) bool { return ev.Type == trace.EvGoSysCall && ev.Link != nil }
+	events := []*trace.Event{create, ev, end}
+
+	for _, tt := range []struct {
+		name    string
+		filter  *profFilter
+		samples int
+	}{
+		{"unfiltered", &profFilter{}, 1},
+		{"start after event", &profFilter{hasStart: true, start: 150}, 0},
+		{"start before event", &profFilter{hasStart: true, start: 50}, 1},
+		{"end before event", &profFilter{hasEnd: true, end: 50}, 0},
+		{"end after event", &profFilter{hasEnd: true, end: 150}, 1},
+		{"matching taskid", &profFilter{hasTask: true, task: 9}, 1},
+		{"non-matching taskid", &profFilter{hasTask: true, task: 1}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := buildEventProfile(events, tt.filter, match, linkedDuration, nil)
+			if got := len(p.Sample); got != tt.samples {
+				t.Errorf("got %d samples, want %d", got, tt.samples)
+			}
+		})
+	}
+}
+
+// TestPprofWallSkipsStacklessInitialState checks that a goroutine already
+// blocked (or already in a syscall) when tracing started doesn't produce a
+// sample for that initial span: EvGoWaiting/EvGoInSyscall carry no stack to
+// attribute it to, so the span must be dropped rather than faked.
+func TestPprofWallSkipsStacklessInitialState(t *testing.T) {
+	const g = 1
+	waiting := &trace.Event{Type: trace.EvGoWaiting, G: g, Ts: 0}
+	stk := []*trace.Frame{{PC: 1, Fn: "main.worker"}}
+	unblock := &trace.Event{Type: trace.EvGoUnblock, G: 2, StkID: 1, Stk: stk, Ts: 50, Args: [3]uint64{g}}
+	start := &trace.Event{Type: trace.EvGoStart, G: g, Ts: 60}
+
+	p := buildWallProfile([]*trace.Event{waiting, unblock, start}, new(profFilter))
+	if len(p.Sample) != 0 {
+		t.Errorf("got %d samples, want 0 (initial blocked span has no stack to attribute)", len(p.Sample))
+	}
+}
+
+// TestTaskIndexEndOnDifferentGoroutine checks that a task created on one
+// goroutine and ended on another (e.g. handed off to a worker) is still
+// correctly closed, rather than leaking as permanently open on its creating
+// goroutine.
+func TestTaskIndexEndOnDifferentGoroutine(t *testing.T) {
+	const creator, worker = 1, 2
+	create := &trace.Event{Type: trace.EvUserTaskCreate, G: creator, Args: [3]uint64{7}}
+	end := &trace.Event{Type: trace.EvUserTaskEnd, G: worker, Args: [3]uint64{7}}
+	after := &trace.Event{Type: trace.EvGoSysCall, G: creator}
+
+	index := taskIndex([]*trace.Event{create, end, after})
+
+	if id, ok := index[after]; ok {
+		t.Errorf("event after task end got task %d, want no task (task should have closed)", id)
+	}
+}